@@ -22,41 +22,66 @@ package xds
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 
 	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
-	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
-	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
-	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 )
 
 var log = clog.NewWithPlugin("traffic")
 
+// Mode selects the xDS wire protocol the client speaks to the management server.
+type Mode int
+
 const (
-	cdsURL = "type.googleapis.com/envoy.api.v2.Cluster"
-	edsURL = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
+	// SoTW drives the classic State-of-the-World StreamAggregatedResources stream, where every
+	// response carries the full resource snapshot for its type.
+	SoTW Mode = iota
+	// Delta drives the incremental DeltaAggregatedResources stream, where responses only carry
+	// the resources that were added or changed plus the names of the ones that were removed.
+	Delta
 )
 
-type adsStream adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient
-
 type Client struct {
 	cc          *grpc.ClientConn
 	ctx         context.Context
 	assignments assignment
-	node        *corepb.Node
+	node        proto.Message
 	cancel      context.CancelFunc
+	mode        Mode
+	xport       transport
+
+	// subscribed tracks, per type URL, the resource names we've last told the management server
+	// we're interested in. Delta requests only carry the subscribe/unsubscribe diff against this.
+	subMu      sync.Mutex
+	subscribed map[string]map[string]bool
+
+	// initialVersionsSent tracks, per type URL, whether a DeltaDiscoveryRequest has gone out on
+	// the current Delta stream yet. InitialResourceVersions is only valid on that first request.
+	initialVersionsSent map[string]bool
+
+	// dnsResolvers tracks the running resolver goroutine (by its cancel func) for each
+	// LOGICAL_DNS/STRICT_DNS cluster, keyed by cluster name.
+	dnsMu        sync.Mutex
+	dnsResolvers map[string]context.CancelFunc
+
+	// pickObservers are notified of the first endpoint of every Pick/PickSRV result; see Observe.
+	pickMu        sync.Mutex
+	pickObservers []PickObserver
 }
 
 type assignment struct {
-	mu      sync.RWMutex
-	cla     map[string]*xdspb.ClusterLoadAssignment
-	version int // not sure what do with and if we should discard all clusters.
+	mu       sync.RWMutex
+	cla      map[string]*xdspb.ClusterLoadAssignment
+	versions map[string]string // per-resource (cluster) version, used to resume Delta streams.
+	version  int               // not sure what do with and if we should discard all clusters.
 }
 
-func (a assignment) SetClusterLoadAssignment(cluster string, cla *xdspb.ClusterLoadAssignment) {
+func (a *assignment) SetClusterLoadAssignment(cluster string, cla *xdspb.ClusterLoadAssignment) {
 	// if cla is nil we just found a cluster, check if we already know about it, or if we need to make
 	// a new entry
 	a.mu.Lock()
@@ -73,11 +98,22 @@ func (a assignment) SetClusterLoadAssignment(cluster string, cla *xdspb.ClusterL
 
 }
 
-func (a assignment) ClusterLoadAssignment(cluster string) *xdspb.ClusterLoadAssignment {
-	return nil
+// DeleteClusterLoadAssignment removes cluster, and its tracked version, from the assignment. It's
+// used when CDS stops reporting a cluster, so stale endpoints don't linger forever.
+func (a *assignment) DeleteClusterLoadAssignment(cluster string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.cla, cluster)
+	delete(a.versions, cluster)
 }
 
-func (a assignment) Clusters() []string {
+func (a *assignment) ClusterLoadAssignment(cluster string) *xdspb.ClusterLoadAssignment {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.cla[cluster]
+}
+
+func (a *assignment) Clusters() []string {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 	clusters := make([]string, len(a.cla))
@@ -89,16 +125,47 @@ func (a assignment) Clusters() []string {
 	return clusters
 }
 
-// New returns a new client that's dialed to addr using node as the local identifier.
-func New(addr, node string) (*Client, error) {
-	// todo credentials
-	opts := []grpc.DialOption{grpc.WithInsecure()}
+// SetVersion records the version of a resource we last applied, so it can be resumed after a
+// reconnect via InitialResourceVersions.
+func (a *assignment) SetVersion(resource, version string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.versions[resource] = version
+}
+
+// Versions returns a copy of the known resource versions, suitable for InitialResourceVersions.
+func (a *assignment) Versions() map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	versions := make(map[string]string, len(a.versions))
+	for k, v := range a.versions {
+		versions[k] = v
+	}
+	return versions
+}
+
+// New returns a new client that's dialed to addr using the Mode, TransportVersion and Node
+// identification carried by cfg. See Config for the available credential options.
+func New(addr string, cfg Config) (*Client, error) {
+	if cfg.Mode == Delta && cfg.TransportVersion == V3 {
+		// discoveryDelta hard-asserts a v2 Node; see the deltaStream doc comment. Reject the combination here
+		// rather than panicking on the first DeltaDiscoveryRequest.
+		return nil, errors.New("xds: Delta mode is only supported with TransportVersion V2")
+	}
+	opts, err := cfg.dialOptions()
+	if err != nil {
+		return nil, err
+	}
 	cc, err := grpc.Dial(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{cc: cc, node: &corepb.Node{Id: "test-id"}} // do more with this node data? Hostname port??
-	c.assignments = assignment{cla: make(map[string]*xdspb.ClusterLoadAssignment)}
+	xport := newTransport(cfg.TransportVersion)
+	c := &Client{cc: cc, node: xport.buildNode(cfg), mode: cfg.Mode, xport: xport}
+	c.assignments = assignment{cla: make(map[string]*xdspb.ClusterLoadAssignment), versions: make(map[string]string)}
+	c.subscribed = make(map[string]map[string]bool)
+	c.initialVersionsSent = make(map[string]bool)
+	c.dnsResolvers = make(map[string]context.CancelFunc)
 	c.ctx, c.cancel = context.WithCancel(context.Background())
 
 	return c, nil
@@ -106,76 +173,85 @@ func New(addr, node string) (*Client, error) {
 
 func (c *Client) Close() { c.cancel(); c.cc.Close() }
 
-func (c *Client) Run() (adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient, error) {
-	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(c.cc)
-	stream, err := cli.StreamAggregatedResources(c.ctx)
-	if err != nil {
-		return nil, err
+// Run dials the State-of-the-World ADS stream driven by ClusterDiscovery/EndpointDiscovery and
+// Receive. It's only valid when cfg.Mode was SoTW (the default); a client built with Mode Delta
+// must use RunDelta/ReceiveDelta instead.
+func (c *Client) Run() (xdsStream, error) {
+	if c.mode == Delta {
+		return nil, errors.New("xds: Mode is Delta, use RunDelta instead of Run")
 	}
-	return stream, nil
+	return c.xport.dial(c.ctx, c.cc)
 }
 
-func (c *Client) ClusterDiscovery(stream adsStream, version, nonce string, clusters []string) error {
-	req := &xdspb.DiscoveryRequest{
-		Node:          c.node,
-		TypeUrl:       cdsURL,
-		ResourceNames: clusters, // empty for all
-		VersionInfo:   version,
-		ResponseNonce: nonce,
-	}
-	return stream.Send(req)
+func (c *Client) ClusterDiscovery(stream xdsStream, version, nonce string, clusters []string) error {
+	cds, _ := c.xport.typeURLs()
+	return stream.Send(c.xport.request(c.node, cds, version, nonce, clusters)) // empty clusters for all
 }
 
-func (c *Client) EndpointDiscovery(stream adsStream, version, nonce string, clusters []string) error {
-	req := &xdspb.DiscoveryRequest{
-		Node:          c.node,
-		TypeUrl:       edsURL,
-		ResourceNames: clusters,
-		VersionInfo:   version,
-		ResponseNonce: nonce,
-	}
-	return stream.Send(req)
+func (c *Client) EndpointDiscovery(stream xdsStream, version, nonce string, clusters []string) error {
+	_, eds := c.xport.typeURLs()
+	return stream.Send(c.xport.request(c.node, eds, version, nonce, clusters))
 }
 
-func (c *Client) Receive(stream adsStream) error {
+func (c *Client) Receive(stream xdsStream) error {
+	cds, eds := c.xport.typeURLs()
 	for {
-		resp, err := stream.Recv()
+		typeURL, version, nonce, resources, err := stream.Recv()
 		if err != nil {
 			return err
 		}
 
-		switch resp.GetTypeUrl() {
-		case cdsURL:
-			for _, r := range resp.GetResources() {
-				var any ptypes.DynamicAny
-				if err := ptypes.UnmarshalAny(r, &any); err != nil {
-					continue
-				}
-				cluster, ok := any.Message.(*xdspb.Cluster)
+		switch typeURL {
+		case cds:
+			before := c.assignments.Clusters()
+			seen := make(map[string]bool, len(resources))
+			var edsClusters []string
+			var dnsClusters []*clusterInfo
+			for _, r := range resources {
+				info, ok := c.xport.parseCluster(r)
 				if !ok {
 					continue
 				}
-				c.assignments.SetClusterLoadAssignment(cluster.GetName(), nil)
+				seen[info.name] = true
+				c.assignments.SetClusterLoadAssignment(info.name, nil)
+				if info.typ == clusterEDS {
+					edsClusters = append(edsClusters, info.name)
+				} else {
+					dnsClusters = append(dnsClusters, info)
+				}
+			}
+			// A cluster that dropped out of this CDS response is gone: flush its endpoints so
+			// the picker returns nothing for it instead of serving stale answers forever.
+			for _, name := range before {
+				if !seen[name] {
+					c.assignments.DeleteClusterLoadAssignment(name)
+				}
 			}
-			println("HERER", len(resp.GetResources()))
-			log.Debug("Cluster discovery processed with %d resources", len(resp.GetResources()))
+			c.syncDNSClusters(dnsClusters)
+			log.Debug("Cluster discovery processed with %d resources", len(resources))
 			// ack the CDS proto, with we we've got. (empty version would be NACK)
-			if err := c.ClusterDiscovery(stream, resp.GetVersionInfo(), resp.GetNonce(), c.assignments.Clusters()); err != nil {
+			if err := c.ClusterDiscovery(stream, version, nonce, c.assignments.Clusters()); err != nil {
 				log.Warningf("Failed to acknowledge cluster discovery: %s", err)
 			}
 			// need to figure out how to handle the version exactly.
 
-			// now kick off discovery for endpoints
-			if err := c.EndpointDiscovery(stream, "", "", c.assignments.Clusters()); err != nil {
+			// now kick off discovery for endpoints, for the clusters that actually use EDS
+			if err := c.EndpointDiscovery(stream, "", "", edsClusters); err != nil {
 				log.Warningf("Failed to perform endpoint discovery: %s", err)
 			}
 
-		case edsURL:
-			println("EDS")
+		case eds:
+			for _, r := range resources {
+				cla, ok := c.xport.parseClusterLoadAssignment(r)
+				if !ok {
+					continue
+				}
+				c.assignments.SetClusterLoadAssignment(cla.GetClusterName(), cla)
+			}
+			log.Debug("Endpoint discovery processed with %d resources", len(resources))
 		default:
-			log.Warningf("Unknown response URL for discovery: %q", resp.GetTypeUrl())
+			log.Warningf("Unknown response URL for discovery: %q", typeURL)
 			continue
 		}
 	}
-	return nil
 }
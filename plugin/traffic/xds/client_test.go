@@ -0,0 +1,101 @@
+package xds_test
+
+import (
+	"io"
+	"testing"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"github.com/coredns/coredns/plugin/traffic/xds"
+)
+
+// These must match the v2 CDS/EDS type URLs the client's default (V2) transport uses.
+const (
+	regressionCDSTypeURL = "type.googleapis.com/envoy.api.v2.Cluster"
+	regressionEDSTypeURL = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
+	regressionCluster    = "flaky-cluster"
+)
+
+// fakeStream feeds a canned sequence of responses to Client.Receive without a real ADS
+// connection, ending the stream with io.EOF once it runs out.
+type fakeStream struct {
+	responses []fakeResponse
+	i         int
+}
+
+type fakeResponse struct {
+	typeURL   string
+	resources []*any.Any
+}
+
+func (f *fakeStream) Send(proto.Message) error { return nil }
+
+func (f *fakeStream) Recv() (typeURL, version, nonce string, resources []*any.Any, err error) {
+	if f.i >= len(f.responses) {
+		return "", "", "", nil, io.EOF
+	}
+	r := f.responses[f.i]
+	f.i++
+	return r.typeURL, "1", "1", r.resources, nil
+}
+
+func mustAny(t *testing.T, m proto.Message) *any.Any {
+	t.Helper()
+	a, err := ptypes.MarshalAny(m)
+	if err != nil {
+		t.Fatalf("MarshalAny: %s", err)
+	}
+	return a
+}
+
+// TestClusterFlushedWhenCDSStopsReporting drives a Client through a CDS response that reports
+// regressionCluster (with a healthy EDS endpoint) and then a CDS response that no longer mentions
+// it, and asserts the picker has nothing left for the cluster afterwards - a regression test for
+// the cluster-removal flush in Client.Receive.
+func TestClusterFlushedWhenCDSStopsReporting(t *testing.T) {
+	cluster := mustAny(t, &xdspb.Cluster{Name: regressionCluster, Type: xdspb.Cluster_EDS})
+	cla := mustAny(t, &xdspb.ClusterLoadAssignment{
+		ClusterName: regressionCluster,
+		Endpoints: []*xdspb.LocalityLbEndpoints{{
+			LbEndpoints: []*xdspb.LbEndpoint{{
+				HostIdentifier: &xdspb.LbEndpoint_Endpoint{
+					Endpoint: &xdspb.Endpoint{
+						Address: &corepb.Address{
+							Address: &corepb.Address_SocketAddress{
+								SocketAddress: &corepb.SocketAddress{
+									Address:       "10.0.0.5",
+									PortSpecifier: &corepb.SocketAddress_PortValue{PortValue: 8080},
+								},
+							},
+						},
+					},
+				},
+				HealthStatus: corepb.HealthStatus_HEALTHY,
+			}},
+		}},
+	})
+
+	stream := &fakeStream{responses: []fakeResponse{
+		{typeURL: regressionCDSTypeURL, resources: []*any.Any{cluster}},
+		{typeURL: regressionEDSTypeURL, resources: []*any.Any{cla}},
+		{typeURL: regressionCDSTypeURL, resources: nil}, // cluster no longer reported
+	}}
+
+	c, err := xds.New("127.0.0.1:0", xds.Config{})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	defer c.Close()
+
+	if err := c.Receive(stream); err != io.EOF {
+		t.Fatalf("Receive: got %v, want io.EOF", err)
+	}
+
+	if ips := c.Pick(regressionCluster); len(ips) != 0 {
+		t.Fatalf("Pick(%q) = %v after CDS stopped reporting it, want empty", regressionCluster, ips)
+	}
+}
@@ -0,0 +1,174 @@
+package xds_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepbv3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	adsgrpcv2 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	adsgrpcv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	cachev2 "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	cachev3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	serverv2 "github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	serverv3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"google.golang.org/grpc"
+
+	"github.com/coredns/coredns/plugin/traffic/xds"
+)
+
+const (
+	conformanceNode    = "conformance-node"
+	conformanceCluster = "conformance-cluster"
+	conformanceIP      = "10.0.0.1"
+	conformancePort    = 8080
+)
+
+// TestConformance runs the same CDS/EDS scenario - one cluster, one healthy endpoint - against an
+// in-memory go-control-plane snapshot cache speaking v2 and then v3, and asserts the picker
+// resolves the cluster identically under both wire protocols.
+func TestConformance(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		version xds.TransportVersion
+	}{
+		{"v2", xds.V2},
+		{"v3", xds.V3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, stop := startConformanceServer(t, tc.version)
+			defer stop()
+
+			c, err := xds.New(addr, xds.Config{TransportVersion: tc.version, NodeID: conformanceNode})
+			if err != nil {
+				t.Fatalf("New: %s", err)
+			}
+			defer c.Close()
+
+			stream, err := c.Run()
+			if err != nil {
+				t.Fatalf("Run: %s", err)
+			}
+			go c.Receive(stream)
+
+			if err := c.ClusterDiscovery(stream, "", "", nil); err != nil {
+				t.Fatalf("ClusterDiscovery: %s", err)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				ips := c.Pick(conformanceCluster)
+				if len(ips) == 1 && ips[0].String() == conformanceIP {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("timed out waiting for %s to resolve to %s, got %v", conformanceCluster, conformanceIP, ips)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// startConformanceServer starts an in-process ADS server, backed by a go-control-plane
+// SnapshotCache seeded with a single Cluster/ClusterLoadAssignment pair, and returns the address
+// to dial along with a func to tear it down.
+func startConformanceServer(t *testing.T, version xds.TransportVersion) (addr string, stop func()) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	grpcServer := grpc.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	switch version {
+	case xds.V2:
+		snapshotCache := cachev2.NewSnapshotCache(true, cachev2.IDHash{}, nil)
+		snapshot := cachev2.NewSnapshot("1",
+			[]cachev2.Resource{conformanceV2ClusterLoadAssignment()},
+			[]cachev2.Resource{conformanceV2Cluster()},
+			nil, nil, nil)
+		if err := snapshotCache.SetSnapshot(conformanceNode, snapshot); err != nil {
+			t.Fatalf("SetSnapshot: %s", err)
+		}
+		adsgrpcv2.RegisterAggregatedDiscoveryServiceServer(grpcServer, serverv2.NewServer(ctx, snapshotCache, nil))
+	case xds.V3:
+		snapshotCache := cachev3.NewSnapshotCache(true, cachev3.IDHash{}, nil)
+		snapshot := cachev3.NewSnapshot("1",
+			[]cachev3.Resource{conformanceV3ClusterLoadAssignment()},
+			[]cachev3.Resource{conformanceV3Cluster()},
+			nil, nil, nil)
+		if err := snapshotCache.SetSnapshot(conformanceNode, snapshot); err != nil {
+			t.Fatalf("SetSnapshot: %s", err)
+		}
+		adsgrpcv3.RegisterAggregatedDiscoveryServiceServer(grpcServer, serverv3.NewServer(ctx, snapshotCache, nil))
+	}
+
+	go grpcServer.Serve(lis)
+
+	return lis.Addr().String(), func() {
+		cancel()
+		grpcServer.Stop()
+	}
+}
+
+func conformanceV2Cluster() *xdspb.Cluster {
+	return &xdspb.Cluster{Name: conformanceCluster, Type: xdspb.Cluster_EDS}
+}
+
+func conformanceV2ClusterLoadAssignment() *xdspb.ClusterLoadAssignment {
+	return &xdspb.ClusterLoadAssignment{
+		ClusterName: conformanceCluster,
+		Endpoints: []*xdspb.LocalityLbEndpoints{{
+			LbEndpoints: []*xdspb.LbEndpoint{{
+				HostIdentifier: &xdspb.LbEndpoint_Endpoint{
+					Endpoint: &xdspb.Endpoint{
+						Address: &corepb.Address{
+							Address: &corepb.Address_SocketAddress{
+								SocketAddress: &corepb.SocketAddress{
+									Address:       conformanceIP,
+									PortSpecifier: &corepb.SocketAddress_PortValue{PortValue: conformancePort},
+								},
+							},
+						},
+					},
+				},
+				HealthStatus: corepb.HealthStatus_HEALTHY,
+			}},
+		}},
+	}
+}
+
+func conformanceV3Cluster() *clusterpb.Cluster {
+	return &clusterpb.Cluster{Name: conformanceCluster, Type: clusterpb.Cluster_EDS}
+}
+
+func conformanceV3ClusterLoadAssignment() *endpointpb.ClusterLoadAssignment {
+	return &endpointpb.ClusterLoadAssignment{
+		ClusterName: conformanceCluster,
+		Endpoints: []*endpointpb.LocalityLbEndpoints{{
+			LbEndpoints: []*endpointpb.LbEndpoint{{
+				HostIdentifier: &endpointpb.LbEndpoint_Endpoint{
+					Endpoint: &endpointpb.Endpoint{
+						Address: &corepbv3.Address{
+							Address: &corepbv3.Address_SocketAddress{
+								SocketAddress: &corepbv3.SocketAddress{
+									Address:       conformanceIP,
+									PortSpecifier: &corepbv3.SocketAddress_PortValue{PortValue: conformancePort},
+								},
+							},
+						},
+					},
+				},
+				HealthStatus: corepbv3.HealthStatus_HEALTHY,
+			}},
+		}},
+	}
+}
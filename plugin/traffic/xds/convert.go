@@ -0,0 +1,62 @@
+package xds
+
+import (
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	v2corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	v3corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+)
+
+// v3ToV2ClusterLoadAssignment copies the fields of a v3 ClusterLoadAssignment into the v2 type, so
+// a v3 control plane's EDS responses can be stored alongside v2 ones and the picker doesn't need
+// to special-case the wire version.
+func v3ToV2ClusterLoadAssignment(in *endpointpb.ClusterLoadAssignment) *xdspb.ClusterLoadAssignment {
+	out := &xdspb.ClusterLoadAssignment{ClusterName: in.GetClusterName()}
+	for _, le := range in.GetEndpoints() {
+		out.Endpoints = append(out.Endpoints, &xdspb.LocalityLbEndpoints{
+			Locality:            v3ToV2Locality(le.GetLocality()),
+			LbEndpoints:         v3ToV2LbEndpoints(le.GetLbEndpoints()),
+			LoadBalancingWeight: le.GetLoadBalancingWeight(),
+			Priority:            le.GetPriority(),
+		})
+	}
+	return out
+}
+
+func v3ToV2Locality(in *v3corepb.Locality) *v2corepb.Locality {
+	if in == nil {
+		return nil
+	}
+	return &v2corepb.Locality{Region: in.GetRegion(), Zone: in.GetZone(), SubZone: in.GetSubZone()}
+}
+
+func v3ToV2LbEndpoints(in []*endpointpb.LbEndpoint) []*xdspb.LbEndpoint {
+	out := make([]*xdspb.LbEndpoint, 0, len(in))
+	for _, e := range in {
+		out = append(out, &xdspb.LbEndpoint{
+			HostIdentifier:      v3ToV2HostIdentifier(e),
+			HealthStatus:        v2corepb.HealthStatus(e.GetHealthStatus()),
+			LoadBalancingWeight: e.GetLoadBalancingWeight(),
+		})
+	}
+	return out
+}
+
+func v3ToV2HostIdentifier(e *endpointpb.LbEndpoint) *xdspb.LbEndpoint_Endpoint {
+	addr := e.GetEndpoint().GetAddress().GetSocketAddress()
+	if addr == nil {
+		return nil
+	}
+	return &xdspb.LbEndpoint_Endpoint{
+		Endpoint: &xdspb.Endpoint{
+			Address: &v2corepb.Address{
+				Address: &v2corepb.Address_SocketAddress{
+					SocketAddress: &v2corepb.SocketAddress{
+						Address:       addr.GetAddress(),
+						PortSpecifier: &v2corepb.SocketAddress_PortValue{PortValue: addr.GetPortValue()},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,187 @@
+package xds
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Locality identifies where the client is running, so the control plane can return
+// locality-scoped EDS (e.g. prefer endpoints in the same zone).
+type Locality struct {
+	Region, Zone, SubZone string
+}
+
+// Config carries everything needed to dial and identify the client to the ADS management
+// server: the wire protocol to use, the credentials to secure the channel with, and the Node
+// fields announced on every DiscoveryRequest.
+type Config struct {
+	Mode             Mode
+	TransportVersion TransportVersion
+
+	// TLS is used as-is if set. Leave it nil and set CertFile/KeyFile (and optionally CAFile)
+	// instead to have the client watch those files on disk and rotate credentials in place
+	// whenever they change, without tearing down the ADS stream.
+	TLS      *tls.Config
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// PerRPCCredentials, when set, is attached to every RPC on top of (or instead of) TLS, e.g.
+	// an SDS-style bearer token source.
+	PerRPCCredentials credentials.PerRPCCredentials
+
+	NodeID           string
+	Cluster          string
+	Locality         Locality
+	Metadata         map[string]interface{}
+	UserAgentName    string
+	UserAgentVersion string
+}
+
+// dialOptions builds the grpc.DialOption(s) that secure the ADS channel per cfg.
+func (cfg Config) dialOptions() ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	switch {
+	case cfg.TLS != nil:
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cfg.TLS)))
+	case cfg.CertFile != "" || cfg.KeyFile != "" || cfg.CAFile != "":
+		reloader, err := newReloadingCreds(cfg.CertFile, cfg.KeyFile, cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(reloader))
+	default:
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if cfg.PerRPCCredentials != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(cfg.PerRPCCredentials))
+	}
+	return opts, nil
+}
+
+// reloadingCreds is a credentials.TransportCredentials that swaps in freshly loaded certificates
+// whenever the watched cert/key/CA files change on disk, so a long-lived ADS stream survives
+// certificate rotation without needing a full client restart.
+type reloadingCreds struct {
+	mu    sync.RWMutex
+	inner credentials.TransportCredentials
+}
+
+func newReloadingCreds(certFile, keyFile, caFile string) (credentials.TransportCredentials, error) {
+	r := &reloadingCreds{}
+	if err := r.reload(certFile, keyFile, caFile); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range []string{certFile, keyFile, caFile} {
+		if f == "" {
+			continue
+		}
+		if err := watcher.Add(f); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		for range watcher.Events {
+			if err := r.reload(certFile, keyFile, caFile); err != nil {
+				log.Warningf("Failed to reload ADS TLS credentials: %s", err)
+			}
+		}
+	}()
+
+	return r, nil
+}
+
+func (r *reloadingCreds) reload(certFile, keyFile, caFile string) error {
+	tc := &tls.Config{}
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("xds: failed to parse CA certificate %s", caFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	r.mu.Lock()
+	r.inner = credentials.NewTLS(tc)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *reloadingCreds) current() credentials.TransportCredentials {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.inner
+}
+
+func (r *reloadingCreds) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return r.current().ClientHandshake(ctx, addr, rawConn)
+}
+
+func (r *reloadingCreds) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return r.current().ServerHandshake(rawConn)
+}
+
+func (r *reloadingCreds) Info() credentials.ProtocolInfo { return r.current().Info() }
+
+func (r *reloadingCreds) Clone() credentials.TransportCredentials {
+	return &reloadingCreds{inner: r.current()}
+}
+
+func (r *reloadingCreds) OverrideServerName(name string) error {
+	return r.current().OverrideServerName(name)
+}
+
+// newStruct converts m into the protobuf Struct carried on Node.Metadata, shared by the v2 and
+// v3 Node types since both use the same well-known Struct wire type.
+func newStruct(m map[string]interface{}) *structpb.Struct {
+	if len(m) == 0 {
+		return nil
+	}
+	fields := make(map[string]*structpb.Value, len(m))
+	for k, v := range m {
+		fields[k] = newValue(v)
+	}
+	return &structpb.Struct{Fields: fields}
+}
+
+func newValue(v interface{}) *structpb.Value {
+	switch t := v.(type) {
+	case string:
+		return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: t}}
+	case bool:
+		return &structpb.Value{Kind: &structpb.Value_BoolValue{BoolValue: t}}
+	case float64:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: t}}
+	case int:
+		return &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(t)}}
+	default:
+		return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: fmt.Sprintf("%v", t)}}
+	}
+}
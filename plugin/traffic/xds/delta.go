@@ -0,0 +1,180 @@
+package xds
+
+import (
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/golang/protobuf/ptypes"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// deltaStream is v2-only for now; Delta ADS for v3 control planes can reuse the same bookkeeping
+// once a transport-style abstraction is needed here too.
+type deltaStream adsgrpc.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
+
+// RunDelta dials the management server's incremental ADS endpoint. It's used instead of Run when
+// the client was constructed with Mode Delta.
+func (c *Client) RunDelta() (adsgrpc.AggregatedDiscoveryService_DeltaAggregatedResourcesClient, error) {
+	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(c.cc)
+	stream, err := cli.DeltaAggregatedResources(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A new stream means initial_resource_versions needs to be sent again, once, on its first
+	// request per type URL, and that the server on it has been told of no subscriptions yet.
+	c.subMu.Lock()
+	c.initialVersionsSent = make(map[string]bool)
+	c.subscribed = make(map[string]map[string]bool)
+	c.subMu.Unlock()
+	return stream, nil
+}
+
+// subscriptionDiff returns the resource names that need to be added to, and removed from, the
+// type URL's subscription to arrive at want. It also updates the tracked subscription.
+func (c *Client) subscriptionDiff(typeURL string, want []string) (subscribe, unsubscribe []string) {
+	wantSet := make(map[string]bool, len(want))
+	for _, w := range want {
+		wantSet[w] = true
+	}
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	have, ok := c.subscribed[typeURL]
+	if !ok {
+		have = make(map[string]bool)
+		c.subscribed[typeURL] = have
+	}
+
+	for w := range wantSet {
+		if !have[w] {
+			subscribe = append(subscribe, w)
+		}
+	}
+	for h := range have {
+		if !wantSet[h] {
+			unsubscribe = append(unsubscribe, h)
+		}
+	}
+	for _, s := range subscribe {
+		have[s] = true
+	}
+	for _, u := range unsubscribe {
+		delete(have, u)
+	}
+	return subscribe, unsubscribe
+}
+
+// ClusterDiscoveryDelta subscribes to (or unsubscribes from) clusters on the Delta ADS stream,
+// acknowledging nonce. errDetail is non-nil to NACK the last update.
+func (c *Client) ClusterDiscoveryDelta(stream deltaStream, nonce string, clusters []string, errDetail *rpcstatus.Status) error {
+	return c.discoveryDelta(stream, cdsURLv2, nonce, clusters, errDetail)
+}
+
+// EndpointDiscoveryDelta subscribes to (or unsubscribes from) endpoints on the Delta ADS stream,
+// acknowledging nonce. errDetail is non-nil to NACK the last update.
+func (c *Client) EndpointDiscoveryDelta(stream deltaStream, nonce string, clusters []string, errDetail *rpcstatus.Status) error {
+	return c.discoveryDelta(stream, edsURLv2, nonce, clusters, errDetail)
+}
+
+func (c *Client) discoveryDelta(stream deltaStream, typeURL, nonce string, resources []string, errDetail *rpcstatus.Status) error {
+	subscribe, unsubscribe := c.subscriptionDiff(typeURL, resources)
+	req := &xdspb.DeltaDiscoveryRequest{
+		Node:                     c.node.(*corepb.Node), // Delta is v2-only, see the deltaStream doc comment.
+		TypeUrl:                  typeURL,
+		ResourceNamesSubscribe:   subscribe,
+		ResourceNamesUnsubscribe: unsubscribe,
+		InitialResourceVersions:  c.initialResourceVersions(typeURL),
+		ResponseNonce:            nonce,
+		ErrorDetail:              errDetail,
+	}
+	return stream.Send(req)
+}
+
+// initialResourceVersions returns the known resource versions for typeURL, but only on the first
+// DeltaDiscoveryRequest sent for it on the current stream: the xDS delta protocol treats
+// initial_resource_versions as describing the client's state when the stream was (re)opened, and
+// resending it on every subsequent request/ACK is a protocol violation.
+func (c *Client) initialResourceVersions(typeURL string) map[string]string {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.initialVersionsSent[typeURL] {
+		return nil
+	}
+	c.initialVersionsSent[typeURL] = true
+	return c.assignments.Versions()
+}
+
+// ReceiveDelta consumes DeltaDiscoveryResponse messages from stream, applying Resources as
+// upserts and RemovedResources as deletes, and acks each update. It never NACKs: resources that
+// fail to unmarshal are skipped and the update is still acked with a nil errDetail.
+func (c *Client) ReceiveDelta(stream deltaStream) error {
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch resp.GetTypeUrl() {
+		case cdsURLv2:
+			clusters := c.applyDeltaClusters(resp)
+			log.Debug("Cluster discovery processed with %d resources", len(resp.GetResources()))
+			if err := c.ClusterDiscoveryDelta(stream, resp.GetNonce(), c.assignments.Clusters(), nil); err != nil {
+				log.Warningf("Failed to acknowledge cluster discovery: %s", err)
+			}
+			if err := c.EndpointDiscoveryDelta(stream, "", clusters, nil); err != nil {
+				log.Warningf("Failed to perform endpoint discovery: %s", err)
+			}
+
+		case edsURLv2:
+			c.applyDeltaEndpoints(resp)
+			if err := c.EndpointDiscoveryDelta(stream, resp.GetNonce(), c.assignments.Clusters(), nil); err != nil {
+				log.Warningf("Failed to acknowledge endpoint discovery: %s", err)
+			}
+
+		default:
+			log.Warningf("Unknown response URL for discovery: %q", resp.GetTypeUrl())
+			continue
+		}
+	}
+}
+
+// applyDeltaClusters applies a CDS DeltaDiscoveryResponse to the assignment map and returns the
+// names of the clusters that are currently known, so EDS can be (re)subscribed for them.
+func (c *Client) applyDeltaClusters(resp *xdspb.DeltaDiscoveryResponse) []string {
+	for _, r := range resp.GetResources() {
+		var any ptypes.DynamicAny
+		if err := ptypes.UnmarshalAny(r.GetResource(), &any); err != nil {
+			continue
+		}
+		cluster, ok := any.Message.(*xdspb.Cluster)
+		if !ok {
+			continue
+		}
+		c.assignments.SetClusterLoadAssignment(cluster.GetName(), nil)
+		c.assignments.SetVersion(cluster.GetName(), r.GetVersion())
+	}
+	for _, name := range resp.GetRemovedResources() {
+		c.assignments.DeleteClusterLoadAssignment(name)
+	}
+	return c.assignments.Clusters()
+}
+
+// applyDeltaEndpoints applies an EDS DeltaDiscoveryResponse to the assignment map, clearing the
+// resources named in RemovedResources the same way applyDeltaClusters does for CDS.
+func (c *Client) applyDeltaEndpoints(resp *xdspb.DeltaDiscoveryResponse) {
+	for _, r := range resp.GetResources() {
+		var any ptypes.DynamicAny
+		if err := ptypes.UnmarshalAny(r.GetResource(), &any); err != nil {
+			continue
+		}
+		cla, ok := any.Message.(*xdspb.ClusterLoadAssignment)
+		if !ok {
+			continue
+		}
+		c.assignments.SetClusterLoadAssignment(cla.GetClusterName(), cla)
+		c.assignments.SetVersion(cla.GetClusterName(), r.GetVersion())
+	}
+	for _, name := range resp.GetRemovedResources() {
+		c.assignments.DeleteClusterLoadAssignment(name)
+	}
+}
@@ -0,0 +1,132 @@
+package xds
+
+import (
+	"context"
+	"net"
+	"time"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+// defaultDNSRefreshRate is used for LOGICAL_DNS/STRICT_DNS clusters that don't set
+// dns_refresh_rate.
+const defaultDNSRefreshRate = 5 * time.Second
+
+// clusterType classifies how a CDS Cluster's membership is discovered.
+type clusterType int
+
+const (
+	// clusterEDS is resolved the normal way, via an EDS subscription.
+	clusterEDS clusterType = iota
+	// clusterLogicalDNS and clusterStrictDNS are resolved by the client itself, by periodically
+	// re-resolving the hostnames embedded in the cluster instead of waiting on EDS.
+	clusterLogicalDNS
+	clusterStrictDNS
+)
+
+// dnsHost is one hostname (and its port) to resolve for a LOGICAL_DNS/STRICT_DNS cluster.
+type dnsHost struct {
+	hostname string
+	port     uint32
+}
+
+// clusterInfo is the protocol-agnostic view of a CDS Cluster the client acts on.
+type clusterInfo struct {
+	name    string
+	typ     clusterType
+	hosts   []dnsHost     // set when typ is clusterLogicalDNS or clusterStrictDNS
+	refresh time.Duration // dns_refresh_rate, defaulted to defaultDNSRefreshRate
+}
+
+// syncDNSClusters starts a resolver goroutine for every DNS cluster in infos that doesn't already
+// have one, and stops the resolvers for DNS clusters that are no longer reported by CDS.
+func (c *Client) syncDNSClusters(infos []*clusterInfo) {
+	want := make(map[string]*clusterInfo)
+	for _, info := range infos {
+		if info.typ == clusterLogicalDNS || info.typ == clusterStrictDNS {
+			want[info.name] = info
+		}
+	}
+
+	c.dnsMu.Lock()
+	defer c.dnsMu.Unlock()
+	for name, cancel := range c.dnsResolvers {
+		if _, ok := want[name]; !ok {
+			cancel()
+			delete(c.dnsResolvers, name)
+		}
+	}
+	for name, info := range want {
+		if _, ok := c.dnsResolvers[name]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(c.ctx)
+		c.dnsResolvers[name] = cancel
+		go c.resolveDNSCluster(ctx, info)
+	}
+}
+
+// resolveDNSCluster periodically re-resolves info's hostnames and publishes the result directly
+// into the assignment map, standing in for the EDS update a LOGICAL_DNS/STRICT_DNS cluster never
+// gets.
+func (c *Client) resolveDNSCluster(ctx context.Context, info *clusterInfo) {
+	refresh := info.refresh
+	if refresh <= 0 {
+		refresh = defaultDNSRefreshRate
+	}
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// syncDNSClusters already canceled us, possibly because the cluster was deleted
+			// from assignments; don't race that with a write that would resurrect it.
+			return
+		default:
+		}
+		c.assignments.SetClusterLoadAssignment(info.name, resolveClusterLoadAssignment(info))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolveClusterLoadAssignment resolves each of info's hostnames with the local resolver and
+// synthesizes a ClusterLoadAssignment out of the results, so the picker can treat a DNS cluster
+// exactly like an EDS one.
+func resolveClusterLoadAssignment(info *clusterInfo) *xdspb.ClusterLoadAssignment {
+	var lbEndpoints []*xdspb.LbEndpoint
+	for _, h := range info.hosts {
+		ips, err := net.LookupHost(h.hostname)
+		if err != nil {
+			log.Warningf("Failed to resolve DNS cluster host %q: %s", h.hostname, err)
+			continue
+		}
+		for _, ip := range ips {
+			lbEndpoints = append(lbEndpoints, &xdspb.LbEndpoint{
+				HostIdentifier: &xdspb.LbEndpoint_Endpoint{
+					Endpoint: &xdspb.Endpoint{
+						Address: &corepb.Address{
+							Address: &corepb.Address_SocketAddress{
+								SocketAddress: &corepb.SocketAddress{
+									Address:       ip,
+									PortSpecifier: &corepb.SocketAddress_PortValue{PortValue: h.port},
+								},
+							},
+						},
+					},
+				},
+				HealthStatus: corepb.HealthStatus_HEALTHY,
+			})
+		}
+	}
+
+	return &xdspb.ClusterLoadAssignment{
+		ClusterName: info.name,
+		Endpoints:   []*xdspb.LocalityLbEndpoints{{LbEndpoints: lbEndpoints}},
+	}
+}
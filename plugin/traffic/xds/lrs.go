@@ -0,0 +1,217 @@
+package xds
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	lrspb "github.com/envoyproxy/go-control-plane/envoy/service/load_stats/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+)
+
+// defaultLoadReportingInterval is used when a LoadStatsResponse carries no valid (positive)
+// load_reporting_interval.
+const defaultLoadReportingInterval = 10 * time.Second
+
+// PickObserver is invoked whenever Pick or PickSRV returns a non-empty result, with the first
+// (top-ranked) endpoint of that result, so a load reporter can tally request counts per locality
+// without the picker depending on it.
+type PickObserver func(cluster string, locality *corepb.Locality)
+
+// Observe registers fn to be called with the cluster and locality of the first endpoint of every
+// non-empty Pick or PickSRV result; the other endpoints of the result are not reported.
+func (c *Client) Observe(fn PickObserver) {
+	c.pickMu.Lock()
+	defer c.pickMu.Unlock()
+	c.pickObservers = append(c.pickObservers, fn)
+}
+
+func (c *Client) notifyPicked(cluster string, e endpoint) {
+	c.pickMu.Lock()
+	observers := append([]PickObserver(nil), c.pickObservers...)
+	c.pickMu.Unlock()
+	for _, fn := range observers {
+		fn(cluster, e.locality)
+	}
+}
+
+// localityCount holds the running counters for one cluster/locality pair. The successful and
+// errors fields are reset to 0 every time they're reported; inProgress is a gauge and isn't.
+type localityCount struct {
+	locality   *corepb.Locality
+	successful int64
+	errors     int64
+	inProgress int64
+}
+
+// LRSClient is the Load Reporting Service sibling to Client: where Client pulls CDS/EDS updates
+// in, LRSClient pushes observed request counts back out, so the control plane can fold real
+// traffic into its balancing decisions. LRS only speaks the v2 wire protocol.
+type LRSClient struct {
+	cc     *grpc.ClientConn
+	node   proto.Message // *corepb.Node
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	clusters []string // clusters the server asked us to report on
+	interval time.Duration
+	counters map[string]map[string]*localityCount // cluster -> locality key -> counts
+}
+
+// NewLRS returns an LRSClient dialed to addr, identifying itself with cfg's Node fields.
+func NewLRS(addr string, cfg Config) (*LRSClient, error) {
+	opts, err := cfg.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	cc, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	l := &LRSClient{
+		cc:       cc,
+		node:     v2Transport{}.buildNode(cfg),
+		counters: make(map[string]map[string]*localityCount),
+	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	return l, nil
+}
+
+func (l *LRSClient) Close() { l.cancel(); l.cc.Close() }
+
+// Run opens the StreamLoadStats stream, applies the server's initial LoadStatsResponse (which
+// clusters to report on, and at what interval), and then reports ClusterStats on that interval
+// until ctx is canceled or the stream fails. A reconnect should call Run again; Envoy's control
+// planes treat each new stream as starting a fresh reporting session.
+func (l *LRSClient) Run() error {
+	cli := lrspb.NewLoadReportingServiceClient(l.cc)
+	stream, err := cli.StreamLoadStats(l.ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Send(&lrspb.LoadStatsRequest{Node: l.node.(*corepb.Node)}); err != nil {
+		return err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	l.applyResponse(resp)
+
+	go l.receiveUpdates(stream)
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		case <-time.After(l.reportingInterval()):
+		}
+		if err := stream.Send(&lrspb.LoadStatsRequest{Node: l.node.(*corepb.Node), ClusterStats: l.snapshot()}); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveUpdates drains LoadStatsResponse pushes for as long as the stream lives, so a server
+// that changes its mind about which clusters to report on (or the interval) mid-stream is honored
+// without needing a full reconnect.
+func (l *LRSClient) receiveUpdates(stream lrspb.LoadReportingService_StreamLoadStatsClient) {
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			log.Warningf("LRS stream closed: %s", err)
+			return
+		}
+		l.applyResponse(resp)
+	}
+}
+
+func (l *LRSClient) applyResponse(resp *lrspb.LoadStatsResponse) {
+	interval, err := ptypes.Duration(resp.GetLoadReportingInterval())
+	if err != nil || interval <= 0 {
+		interval = defaultLoadReportingInterval
+	}
+	l.mu.Lock()
+	l.clusters = resp.GetClusters()
+	l.interval = interval
+	l.mu.Unlock()
+}
+
+func (l *LRSClient) reportingInterval() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.interval
+}
+
+// snapshot builds the ClusterStats for the clusters the server asked about, resetting the
+// request counters (but not the in-progress gauge) as it reports them.
+func (l *LRSClient) snapshot() []*lrspb.ClusterStats {
+	l.mu.Lock()
+	clusters := l.clusters
+	l.mu.Unlock()
+
+	stats := make([]*lrspb.ClusterStats, 0, len(clusters))
+	for _, cluster := range clusters {
+		l.mu.Lock()
+		counts := make([]*localityCount, 0, len(l.counters[cluster]))
+		for _, c := range l.counters[cluster] {
+			counts = append(counts, c)
+		}
+		l.mu.Unlock()
+
+		localityStats := make([]*lrspb.UpstreamLocalityStats, 0, len(counts))
+		for _, c := range counts {
+			localityStats = append(localityStats, &lrspb.UpstreamLocalityStats{
+				Locality:                c.locality,
+				TotalSuccessfulRequests: uint64(atomic.SwapInt64(&c.successful, 0)),
+				TotalErrorRequests:      uint64(atomic.SwapInt64(&c.errors, 0)),
+				TotalRequestsInProgress: uint64(atomic.LoadInt64(&c.inProgress)),
+			})
+		}
+		stats = append(stats, &lrspb.ClusterStats{ClusterName: cluster, UpstreamLocalityStats: localityStats})
+	}
+	return stats
+}
+
+func (l *LRSClient) counts(cluster string, locality *corepb.Locality) *localityCount {
+	key := locality.GetRegion() + "/" + locality.GetZone() + "/" + locality.GetSubZone()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	byLocality, ok := l.counters[cluster]
+	if !ok {
+		byLocality = make(map[string]*localityCount)
+		l.counters[cluster] = byLocality
+	}
+	c, ok := byLocality[key]
+	if !ok {
+		c = &localityCount{locality: locality}
+		byLocality[key] = c
+	}
+	return c
+}
+
+// RecordSuccess and RecordError tally a completed request for cluster/locality, for the traffic
+// plugin to call as it hands out answers and (if it tracks upstream health) sees them succeed or
+// fail. IncrementInProgress/DecrementInProgress bracket a request that's still outstanding.
+func (l *LRSClient) RecordSuccess(cluster string, locality *corepb.Locality) {
+	atomic.AddInt64(&l.counts(cluster, locality).successful, 1)
+}
+
+func (l *LRSClient) RecordError(cluster string, locality *corepb.Locality) {
+	atomic.AddInt64(&l.counts(cluster, locality).errors, 1)
+}
+
+func (l *LRSClient) IncrementInProgress(cluster string, locality *corepb.Locality) {
+	atomic.AddInt64(&l.counts(cluster, locality).inProgress, 1)
+}
+
+func (l *LRSClient) DecrementInProgress(cluster string, locality *corepb.Locality) {
+	atomic.AddInt64(&l.counts(cluster, locality).inProgress, -1)
+}
@@ -0,0 +1,201 @@
+package xds
+
+import (
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+// overProvisioningFactor scales a priority's healthy fraction (the result is capped at 1.0), so a
+// slightly degraded priority still takes its full traffic share; see https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/upstream/load_balancing/priority.
+const overProvisioningFactor = 1.4
+
+// endpoint is the load-balancer's flattened view of a single LbEndpoint: enough to pick and
+// answer with, independent of locality or priority bookkeeping.
+type endpoint struct {
+	address  string
+	port     uint32
+	priority uint32
+	weight   uint32 // localityWeight * per-endpoint weight, used for weighted selection.
+	locality *corepb.Locality
+}
+
+// Pick returns the addresses of the endpoints currently eligible to answer for cluster, ordered
+// by a priority-failover, locality-weighted random selection. The traffic plugin uses this to
+// synthesize A/AAAA answers.
+func (c *Client) Pick(cluster string) []net.IP {
+	eps := c.pickEndpoints(cluster)
+	ips := make([]net.IP, 0, len(eps))
+	for _, e := range eps {
+		if ip := net.ParseIP(e.address); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(eps) > 0 {
+		c.notifyPicked(cluster, eps[0])
+	}
+	return ips
+}
+
+// PickSRV is the SRV equivalent of Pick: it carries the endpoint's port and its relative weight
+// and priority so the traffic plugin can synthesize SRV answers.
+func (c *Client) PickSRV(cluster string) []*net.SRV {
+	eps := c.pickEndpoints(cluster)
+	srv := make([]*net.SRV, 0, len(eps))
+	for _, e := range eps {
+		srv = append(srv, &net.SRV{Target: e.address, Port: uint16(e.port), Priority: uint16(e.priority), Weight: uint16(e.weight)})
+	}
+	if len(eps) > 0 {
+		c.notifyPicked(cluster, eps[0])
+	}
+	return srv
+}
+
+// pickEndpoints implements the xDS priority-failover, locality-weighted-random picker: endpoints
+// are bucketed by priority, each priority's traffic share is its healthy fraction (multiplied by
+// overProvisioningFactor, capped at 1.0) times the share left over by higher priorities, and any share left
+// over after the lowest priority is folded into it so a degraded cluster never goes fully dark.
+// Priorities are kept strictly ordered in the result - a lower priority's endpoints always sort
+// ahead of a higher (worse) priority's - with only the weighted-random shuffle, using locality
+// weight times per-endpoint weight, applied within each priority.
+func (c *Client) pickEndpoints(cluster string) []endpoint {
+	cla := c.assignments.ClusterLoadAssignment(cluster)
+	if cla == nil {
+		return nil
+	}
+
+	byPriority := map[uint32][]*xdspb.LocalityLbEndpoints{}
+	for _, le := range cla.GetEndpoints() {
+		byPriority[le.GetPriority()] = append(byPriority[le.GetPriority()], le)
+	}
+	if len(byPriority) == 0 {
+		return nil
+	}
+
+	priorities := make([]uint32, 0, len(byPriority))
+	for p := range byPriority {
+		priorities = append(priorities, p)
+	}
+	sortUint32s(priorities)
+
+	var picked []endpoint
+	remaining := 1.0
+	for i, p := range priorities {
+		localities := byPriority[p]
+		healthy, total := healthCount(localities)
+		share := 0.0
+		if total > 0 {
+			frac := float64(healthy) / float64(total) * overProvisioningFactor
+			if frac > 1.0 {
+				frac = 1.0
+			}
+			share = remaining * frac
+		}
+		if i == len(priorities)-1 {
+			// Last priority: take whatever traffic share is left, degraded or not, so the
+			// cluster never answers empty just because every priority is partially unhealthy.
+			share = remaining
+		}
+		remaining -= share
+		if share <= 0 {
+			continue
+		}
+		var tier []endpoint
+		for _, le := range localities {
+			tier = append(tier, healthyEndpoints(le, p)...)
+		}
+		weightedShuffle(tier)
+		picked = append(picked, tier...)
+	}
+
+	return picked
+}
+
+// healthCount returns the number of healthy and total endpoints across localities.
+func healthCount(localities []*xdspb.LocalityLbEndpoints) (healthy, total int) {
+	for _, le := range localities {
+		for _, lb := range le.GetLbEndpoints() {
+			total++
+			if isHealthy(lb) {
+				healthy++
+			}
+		}
+	}
+	return healthy, total
+}
+
+func isHealthy(lb *xdspb.LbEndpoint) bool {
+	switch lb.GetHealthStatus() {
+	case corepb.HealthStatus_UNHEALTHY, corepb.HealthStatus_DRAINING:
+		return false
+	default: // UNKNOWN and HEALTHY (and anything else) count as healthy.
+		return true
+	}
+}
+
+// healthyEndpoints flattens a locality's healthy endpoints, weighting each by the locality's
+// LoadBalancingWeight times the endpoint's own weight (both default to 1 when unset).
+func healthyEndpoints(le *xdspb.LocalityLbEndpoints, priority uint32) []endpoint {
+	localityWeight := le.GetLoadBalancingWeight().GetValue()
+	if localityWeight == 0 {
+		localityWeight = 1
+	}
+
+	var out []endpoint
+	for _, lb := range le.GetLbEndpoints() {
+		if !isHealthy(lb) {
+			continue
+		}
+		sock := lb.GetEndpoint().GetAddress().GetSocketAddress()
+		if sock == nil {
+			continue
+		}
+		weight := lb.GetLoadBalancingWeight().GetValue()
+		if weight == 0 {
+			weight = 1
+		}
+		out = append(out, endpoint{
+			address:  sock.GetAddress(),
+			port:     sock.GetPortValue(),
+			priority: priority,
+			weight:   localityWeight * weight,
+			locality: le.GetLocality(),
+		})
+	}
+	return out
+}
+
+// weightedShuffle reorders eps in place via weighted random sampling without replacement (the
+// Efraimidis-Spirakis method), so heavier endpoints are more likely, but not guaranteed, to sort
+// earlier.
+func weightedShuffle(eps []endpoint) {
+	type keyed struct {
+		ep  endpoint
+		key float64
+	}
+	keys := make([]keyed, len(eps))
+	for i, e := range eps {
+		w := float64(e.weight)
+		if w <= 0 {
+			w = 1
+		}
+		keys[i] = keyed{ep: e, key: math.Pow(rand.Float64(), 1/w)}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key > keys[j].key })
+	for i := range eps {
+		eps[i] = keys[i].ep
+	}
+}
+
+// sortUint32s sorts s in ascending order (so priority 0, the highest priority, is handled first).
+func sortUint32s(s []uint32) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j] < s[j-1]; j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package xds
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+)
+
+// TransportVersion selects the xDS protocol generation the client speaks on the wire.
+type TransportVersion int
+
+const (
+	// V2 speaks the deprecated envoy.api.v2 xDS protocol.
+	V2 TransportVersion = iota
+	// V3 speaks envoy.service.discovery.v3, the protocol required by current Envoy and Istio
+	// control planes.
+	V3
+)
+
+// xdsStream is the subset of the generated ADS stream clients the transport needs. It lets Run
+// and Receive stay version-agnostic: Send takes whatever concrete DiscoveryRequest the transport
+// built, and Recv surfaces a DiscoveryResponse's fields without exposing its concrete type, since
+// v2 and v3 responses expose the same accessors but are otherwise distinct Go types.
+type xdsStream interface {
+	Send(proto.Message) error
+	Recv() (typeURL, version, nonce string, resources []*any.Any, err error)
+}
+
+// transport hides the proto packages, type URLs and Node construction that differ between the v2
+// and v3 xDS wire protocols behind a small interface, so Client only ever deals with resource
+// names and raw proto.Any payloads.
+type transport interface {
+	// typeURLs returns the CDS and EDS type URLs for this protocol generation.
+	typeURLs() (cds, eds string)
+	// dial opens the ADS stream for this protocol generation over cc.
+	dial(ctx context.Context, cc *grpc.ClientConn) (xdsStream, error)
+	// buildNode builds the protocol-specific Node announced on every DiscoveryRequest from cfg.
+	buildNode(cfg Config) proto.Message
+	// request builds a version-specific DiscoveryRequest announcing node as the Node.
+	request(node proto.Message, typeURL, version, nonce string, names []string) proto.Message
+	// parseCluster extracts the discovery-relevant fields of a Cluster out of a CDS resource.
+	parseCluster(res *any.Any) (info *clusterInfo, ok bool)
+	// parseClusterLoadAssignment extracts an EDS resource, translating it into the v2
+	// ClusterLoadAssignment type the rest of the client stores its state as.
+	parseClusterLoadAssignment(res *any.Any) (cla *xdspb.ClusterLoadAssignment, ok bool)
+}
+
+// newTransport returns the transport implementation for version.
+func newTransport(version TransportVersion) transport {
+	switch version {
+	case V3:
+		return v3Transport{}
+	default:
+		return v2Transport{}
+	}
+}
@@ -0,0 +1,119 @@
+package xds
+
+import (
+	"context"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+)
+
+const (
+	cdsURLv2 = "type.googleapis.com/envoy.api.v2.Cluster"
+	edsURLv2 = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
+)
+
+// v2Transport implements transport for the deprecated envoy.api.v2 xDS protocol.
+type v2Transport struct{}
+
+func (v2Transport) typeURLs() (cds, eds string) { return cdsURLv2, edsURLv2 }
+
+func (v2Transport) dial(ctx context.Context, cc *grpc.ClientConn) (xdsStream, error) {
+	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(cc)
+	stream, err := cli.StreamAggregatedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return v2Stream{stream}, nil
+}
+
+func (v2Transport) buildNode(cfg Config) proto.Message {
+	node := &corepb.Node{
+		Id:      cfg.NodeID,
+		Cluster: cfg.Cluster,
+		Locality: &corepb.Locality{
+			Region:  cfg.Locality.Region,
+			Zone:    cfg.Locality.Zone,
+			SubZone: cfg.Locality.SubZone,
+		},
+		Metadata:             newStruct(cfg.Metadata),
+		UserAgentName:        cfg.UserAgentName,
+		UserAgentVersionType: &corepb.Node_UserAgentVersion{UserAgentVersion: cfg.UserAgentVersion},
+	}
+	return node
+}
+
+func (v2Transport) request(node proto.Message, typeURL, version, nonce string, names []string) proto.Message {
+	return &xdspb.DiscoveryRequest{
+		Node:          node.(*corepb.Node),
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+		VersionInfo:   version,
+		ResponseNonce: nonce,
+	}
+}
+
+func (v2Transport) parseCluster(res *any.Any) (*clusterInfo, bool) {
+	var a ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(res, &a); err != nil {
+		return nil, false
+	}
+	cluster, ok := a.Message.(*xdspb.Cluster)
+	if !ok {
+		return nil, false
+	}
+
+	info := &clusterInfo{name: cluster.GetName(), typ: clusterEDS}
+	switch cluster.GetType() {
+	case xdspb.Cluster_LOGICAL_DNS:
+		info.typ = clusterLogicalDNS
+	case xdspb.Cluster_STRICT_DNS:
+		info.typ = clusterStrictDNS
+	default:
+		return info, true
+	}
+
+	if d, err := ptypes.Duration(cluster.GetDnsRefreshRate()); err == nil {
+		info.refresh = d
+	}
+	for _, le := range cluster.GetLoadAssignment().GetEndpoints() {
+		for _, lb := range le.GetLbEndpoints() {
+			sock := lb.GetEndpoint().GetAddress().GetSocketAddress()
+			if sock == nil {
+				continue
+			}
+			info.hosts = append(info.hosts, dnsHost{hostname: sock.GetAddress(), port: sock.GetPortValue()})
+		}
+	}
+	return info, true
+}
+
+func (v2Transport) parseClusterLoadAssignment(res *any.Any) (*xdspb.ClusterLoadAssignment, bool) {
+	var a ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(res, &a); err != nil {
+		return nil, false
+	}
+	cla, ok := a.Message.(*xdspb.ClusterLoadAssignment)
+	return cla, ok
+}
+
+// v2Stream adapts the generated SotW ADS stream client to the xdsStream interface.
+type v2Stream struct {
+	adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+}
+
+func (s v2Stream) Send(req proto.Message) error {
+	return s.AggregatedDiscoveryService_StreamAggregatedResourcesClient.Send(req.(*xdspb.DiscoveryRequest))
+}
+
+func (s v2Stream) Recv() (typeURL, version, nonce string, resources []*any.Any, err error) {
+	resp, err := s.AggregatedDiscoveryService_StreamAggregatedResourcesClient.Recv()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	return resp.GetTypeUrl(), resp.GetVersionInfo(), resp.GetNonce(), resp.GetResources(), nil
+}
@@ -0,0 +1,128 @@
+package xds
+
+import (
+	"context"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+)
+
+const (
+	cdsURLv3 = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	edsURLv3 = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+// v3Transport implements transport for envoy.service.discovery.v3, the protocol current Envoy
+// and Istio control planes speak.
+type v3Transport struct{}
+
+func (v3Transport) typeURLs() (cds, eds string) { return cdsURLv3, edsURLv3 }
+
+func (v3Transport) dial(ctx context.Context, cc *grpc.ClientConn) (xdsStream, error) {
+	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(cc)
+	stream, err := cli.StreamAggregatedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return v3Stream{stream}, nil
+}
+
+func (v3Transport) buildNode(cfg Config) proto.Message {
+	node := &corepb.Node{
+		Id:      cfg.NodeID,
+		Cluster: cfg.Cluster,
+		Locality: &corepb.Locality{
+			Region:  cfg.Locality.Region,
+			Zone:    cfg.Locality.Zone,
+			SubZone: cfg.Locality.SubZone,
+		},
+		Metadata:             newStruct(cfg.Metadata),
+		UserAgentName:        cfg.UserAgentName,
+		UserAgentVersionType: &corepb.Node_UserAgentVersion{UserAgentVersion: cfg.UserAgentVersion},
+	}
+	return node
+}
+
+func (v3Transport) request(node proto.Message, typeURL, version, nonce string, names []string) proto.Message {
+	return &adsgrpc.DiscoveryRequest{
+		Node:          node.(*corepb.Node),
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+		VersionInfo:   version,
+		ResponseNonce: nonce,
+	}
+}
+
+func (v3Transport) parseCluster(res *any.Any) (*clusterInfo, bool) {
+	var a ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(res, &a); err != nil {
+		return nil, false
+	}
+	cluster, ok := a.Message.(*clusterpb.Cluster)
+	if !ok {
+		return nil, false
+	}
+
+	info := &clusterInfo{name: cluster.GetName(), typ: clusterEDS}
+	switch cluster.GetType() {
+	case clusterpb.Cluster_LOGICAL_DNS:
+		info.typ = clusterLogicalDNS
+	case clusterpb.Cluster_STRICT_DNS:
+		info.typ = clusterStrictDNS
+	default:
+		return info, true
+	}
+
+	if d, err := ptypes.Duration(cluster.GetDnsRefreshRate()); err == nil {
+		info.refresh = d
+	}
+	for _, le := range cluster.GetLoadAssignment().GetEndpoints() {
+		for _, lb := range le.GetLbEndpoints() {
+			sock := lb.GetEndpoint().GetAddress().GetSocketAddress()
+			if sock == nil {
+				continue
+			}
+			info.hosts = append(info.hosts, dnsHost{hostname: sock.GetAddress(), port: sock.GetPortValue()})
+		}
+	}
+	return info, true
+}
+
+// parseClusterLoadAssignment unmarshals a v3 ClusterLoadAssignment and translates it into the v2
+// type the rest of the client stores its state as, so the picker and assignment map don't need to
+// know which wire version produced them.
+func (v3Transport) parseClusterLoadAssignment(res *any.Any) (*xdspb.ClusterLoadAssignment, bool) {
+	var a ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(res, &a); err != nil {
+		return nil, false
+	}
+	cla, ok := a.Message.(*endpointpb.ClusterLoadAssignment)
+	if !ok {
+		return nil, false
+	}
+	return v3ToV2ClusterLoadAssignment(cla), true
+}
+
+// v3Stream adapts the v3 generated ADS stream client to the xdsStream interface.
+type v3Stream struct {
+	adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+}
+
+func (s v3Stream) Send(req proto.Message) error {
+	return s.AggregatedDiscoveryService_StreamAggregatedResourcesClient.Send(req.(*adsgrpc.DiscoveryRequest))
+}
+
+func (s v3Stream) Recv() (typeURL, version, nonce string, resources []*any.Any, err error) {
+	resp, err := s.AggregatedDiscoveryService_StreamAggregatedResourcesClient.Recv()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	return resp.GetTypeUrl(), resp.GetVersionInfo(), resp.GetNonce(), resp.GetResources(), nil
+}